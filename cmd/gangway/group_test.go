@@ -0,0 +1,145 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api/v1"
+)
+
+func TestGroupsFromClaims(t *testing.T) {
+	claims := jwt.MapClaims{
+		"groups": []interface{}{"a", "b"},
+		"resource_access": map[string]interface{}{
+			"gangway": map[string]interface{}{
+				"roles": []interface{}{"admin", "viewer"},
+			},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		claimPath string
+		want      []string
+	}{
+		{"top-level array claim", "groups", []string{"a", "b"}},
+		{"nested dot-path claim", "resource_access.gangway.roles", []string{"admin", "viewer"}},
+		{"empty claim path", "", nil},
+		{"missing claim", "no-such-claim", nil},
+		{"missing nested segment", "resource_access.other.roles", nil},
+		{"non-array claim", "resource_access", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := groupsFromClaims(claims, c.claimPath)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("groupsFromClaims(%q) = %v, want %v", c.claimPath, got, c.want)
+			}
+		})
+	}
+}
+
+func TestHasAnyGroup(t *testing.T) {
+	cases := []struct {
+		name       string
+		userGroups []string
+		allowed    []string
+		want       bool
+	}{
+		{"shared member", []string{"a", "b"}, []string{"b", "c"}, true},
+		{"no shared member", []string{"a"}, []string{"b"}, false},
+		{"empty allowed denies", []string{"a"}, nil, false},
+		{"empty user groups denies", nil, []string{"a"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := hasAnyGroup(c.userGroups, c.allowed); got != c.want {
+				t.Fatalf("hasAnyGroup(%v, %v) = %v, want %v", c.userGroups, c.allowed, got, c.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizedClusters_NoClusterGroupsConfigured(t *testing.T) {
+	cfg = &Config{
+		Clusters: []clientcmdapi.NamedCluster{{Name: "a"}, {Name: "b"}},
+	}
+
+	got := authorizedClusters(nil)
+	if !reflect.DeepEqual(got, cfg.Clusters) {
+		t.Fatalf("authorizedClusters with no ClusterGroups = %v, want all clusters %v", got, cfg.Clusters)
+	}
+}
+
+func TestAuthorizedClusters_FiltersByGroup(t *testing.T) {
+	cfg = &Config{
+		Clusters: []clientcmdapi.NamedCluster{{Name: "dev"}, {Name: "prod"}},
+		ClusterGroups: map[string][]string{
+			"dev":  {"engineers"},
+			"prod": {"sre"},
+		},
+	}
+
+	got := authorizedClusters([]string{"engineers"})
+	want := []clientcmdapi.NamedCluster{{Name: "dev"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("authorizedClusters = %v, want %v", got, want)
+	}
+}
+
+func TestAuthorizedClusters_DeniesUnmappedCluster(t *testing.T) {
+	cfg = &Config{
+		Clusters: []clientcmdapi.NamedCluster{{Name: "dev"}, {Name: "forgotten"}},
+		ClusterGroups: map[string][]string{
+			"dev": {"engineers"},
+		},
+	}
+
+	// "forgotten" has no ClusterGroups entry, so it must stay excluded
+	// even for a user in every other group.
+	got := authorizedClusters([]string{"engineers", "sre", "admin"})
+	want := []clientcmdapi.NamedCluster{{Name: "dev"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("authorizedClusters = %v, want %v", got, want)
+	}
+}
+
+func TestHomeClusterAuthorized(t *testing.T) {
+	cases := []struct {
+		name          string
+		clusterGroups map[string][]string
+		userGroups    []string
+		want          bool
+	}{
+		{"no ClusterGroups configured at all", nil, nil, true},
+		{"home cluster mapped and authorized", map[string][]string{"home": {"engineers"}}, []string{"engineers"}, true},
+		{"home cluster mapped and denied", map[string][]string{"home": {"engineers"}}, []string{"sre"}, false},
+		{"home cluster unmapped", map[string][]string{"other": {"engineers"}}, []string{"engineers"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg = &Config{ClusterName: "home", ClusterGroups: c.clusterGroups}
+			if got := homeClusterAuthorized(c.userGroups); got != c.want {
+				t.Fatalf("homeClusterAuthorized(%v) = %v, want %v", c.userGroups, got, c.want)
+			}
+		})
+	}
+}
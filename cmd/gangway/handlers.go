@@ -17,25 +17,45 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	htmltemplate "html/template"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
 	"github.com/heptiolabs/gangway/internal/oidc"
+	"github.com/heptiolabs/gangway/internal/tokenmgr"
+	"github.com/heptiolabs/gangway/internal/webauthn"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthenticationv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api/v1"
 )
 
 const (
 	templatesBase = "/templates"
+
+	// pkceVerifierLength is the number of random bytes used to generate the
+	// PKCE code_verifier. Base64url-encoding 64 bytes yields an 86-character
+	// verifier, comfortably within the 43-128 character range required by
+	// RFC 7636.
+	pkceVerifierLength = 64
+
+	// PKCE code_challenge_method values, mirroring cfg.PKCEMethod.
+	pkceMethodPlain = "plain"
+	pkceMethodS256  = "S256"
 )
 
 // userInfo stores information about an authenticated user
@@ -52,13 +72,169 @@ type userInfo struct {
 	ClusterCA    string
 	HTTPPath     string
 	Clusters     []clientcmdapi.NamedCluster
+	Groups       []string
+
+	// HomeClusterAuthorized gates generateKubeConfig's synthesis of the
+	// ClusterName/APIServerURL/ClusterCA "home" cluster, which isn't part
+	// of Clusters (the optional supplementary list) and so isn't covered
+	// by authorizedClusters' filtering on its own.
+	HomeClusterAuthorized bool
+}
+
+// accessDeniedInfo is used to render the access-denied template shown when
+// a user's groups don't authorize them for any cluster.
+type accessDeniedInfo struct {
+	HTTPPath string
+	Groups   []string
 }
 
 // homeInfo is used to store dynamic properties on
 type homeInfo struct {
-	HTTPPath string
+	HTTPPath  string
+	Providers []providerInfo
+}
+
+// providerInfo is the subset of a Provider the home template needs to
+// render the IdP chooser.
+type providerInfo struct {
+	ID   string
+	Name string
+}
+
+// Provider holds one configured OIDC IdP's per-provider settings. Gangway
+// used to assume a single IdP, configured directly on cfg; providers lets
+// one gangway instance federate clusters across several IdPs (Keycloak,
+// Okta, Dex, Google, ...), each reachable at its own /login?provider=<id>
+// and /callback/<id> routes.
+type Provider struct {
+	ID            string
+	Name          string
+	OAuth2Config  *oauth2.Config
+	Audience      string
+	UsernameClaim string
+}
+
+// ProviderConfig is the per-provider block gangway accepts in cfg.Providers,
+// one entry per IdP. It mirrors the handful of OIDC settings cfg used to
+// carry directly back when gangway only ever spoke to a single IdP.
+type ProviderConfig struct {
+	ID            string
+	Name          string
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	Audience      string
+	UsernameClaim string
+}
+
+// providers is keyed by Provider.ID and populated from cfg.Providers on
+// first use. A single-provider deployment still works unmodified: callers
+// that don't specify a provider fall back to the sole entry.
+var (
+	providersMu sync.Mutex
+	providers   map[string]*Provider
+)
+
+// ensureProviders lazily builds the providers map from cfg.Providers, via
+// OIDC discovery against each one's IssuerURL, the first time it's needed -
+// by the time the first request is served, cfg is already fully populated,
+// so there's no separate startup hook to wire up in main. Only a successful
+// load is cached: a transient discovery failure (e.g. the IdP is briefly
+// unreachable) is retried on the next call instead of wedging every future
+// request behind the first one's error.
+func ensureProviders() error {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if providers != nil {
+		return nil
+	}
+
+	loaded, err := loadProviders(cfg.Providers)
+	if err != nil {
+		return err
+	}
+	providers = loaded
+	return nil
+}
+
+// loadProviders turns a list of ProviderConfig entries into Providers keyed
+// by ID, discovering each one's authorization/token endpoints from its
+// IssuerURL.
+func loadProviders(pcs []ProviderConfig) (map[string]*Provider, error) {
+	out := make(map[string]*Provider, len(pcs))
+	for _, pc := range pcs {
+		if pc.ID == "" {
+			return nil, fmt.Errorf("provider configuration is missing an id")
+		}
+
+		doc, err := oidc.Discover(transportConfig.HTTPClient, pc.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover OIDC provider %q at %q: %s", pc.ID, pc.IssuerURL, err)
+		}
+
+		usernameClaim := pc.UsernameClaim
+		if usernameClaim == "" {
+			usernameClaim = cfg.UsernameClaim
+		}
+
+		out[pc.ID] = &Provider{
+			ID:   pc.ID,
+			Name: pc.Name,
+			OAuth2Config: &oauth2.Config{
+				ClientID:     pc.ClientID,
+				ClientSecret: pc.ClientSecret,
+				RedirectURL:  pc.RedirectURL,
+				Scopes:       pc.Scopes,
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  doc.AuthorizationEndpoint,
+					TokenURL: doc.TokenEndpoint,
+				},
+			},
+			Audience:      pc.Audience,
+			UsernameClaim: usernameClaim,
+		}
+	}
+	return out, nil
+}
+
+// resolveProvider looks up a provider by ID. If id is empty and exactly
+// one provider is configured, that provider is returned, so that existing
+// single-IdP deployments don't need to pass ?provider= or /callback/<id>.
+func resolveProvider(id string) (*Provider, error) {
+	if err := ensureProviders(); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC providers: %s", err)
+	}
+
+	if id != "" {
+		p, ok := providers[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %q", id)
+		}
+		return p, nil
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no OIDC providers are configured")
+	}
+
+	if len(providers) == 1 {
+		for _, p := range providers {
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no provider specified and multiple providers are configured")
 }
 
+// webauthnManager is non-nil whenever cfg.WebAuthnRequired is set, and is
+// initialized alongside cfg at startup. It is left nil when the feature is
+// disabled: only the /webauthn handlers use it, and loginRequired only
+// redirects to them when cfg.WebAuthnRequired is set.
+var webauthnManager *webauthn.Manager
+
 func serveTemplate(tmplFile string, data interface{}, w http.ResponseWriter) {
 	var (
 		templatePath string
@@ -92,59 +268,95 @@ func serveTemplate(tmplFile string, data interface{}, w http.ResponseWriter) {
 	tmpl.ExecuteTemplate(w, tmplFile, data)
 }
 
-func generateKubeConfig(cfg *userInfo) clientcmdapi.Config {
+func generateKubeConfig(info *userInfo) clientcmdapi.Config {
 	//Insert all CA data in all clusters
-	cfg.Clusters = append(cfg.Clusters, clientcmdapi.NamedCluster{
-		Name: cfg.ClusterName,
-		Cluster: clientcmdapi.Cluster{
-			Server:                   cfg.APIServerURL,
-			CertificateAuthorityData: []byte(cfg.ClusterCA),
-		},
-	})
+	if info.HomeClusterAuthorized {
+		info.Clusters = append(info.Clusters, clientcmdapi.NamedCluster{
+			Name: info.ClusterName,
+			Cluster: clientcmdapi.Cluster{
+				Server:                   info.APIServerURL,
+				CertificateAuthorityData: []byte(info.ClusterCA),
+			},
+		})
+	}
 	/* TODO update this behavior to instead of writing multiple CA data, point to a ca file */
 	// Create contexts and insert CA Data into 'cluster' structure
 	var contexts []clientcmdapi.NamedContext
-	for _, namedCluster := range cfg.Clusters {
+	for _, namedCluster := range info.Clusters {
 		contexts = append(contexts, clientcmdapi.NamedContext{
 			Name: namedCluster.Name,
 			Context: clientcmdapi.Context{
 				Cluster:  namedCluster.Name,
-				AuthInfo: cfg.Email,
+				AuthInfo: info.Email,
 			},
 		})
-		namedCluster.Cluster.CertificateAuthorityData = []byte(cfg.ClusterCA)
+		namedCluster.Cluster.CertificateAuthorityData = []byte(info.ClusterCA)
+	}
+
+	authInfo := clientcmdapi.AuthInfo{}
+	if cfg.UseExecCredential {
+		// Point kubectl at the exec-plugin instead of embedding the raw
+		// id_token/refresh_token, so the kubeconfig never goes stale: the
+		// plugin hits gangway's /exec-credential endpoint for a live token
+		// on every invocation.
+		authInfo.Exec = &clientcmdapi.ExecConfig{
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Command:    cfg.ExecCredentialCommand,
+			Args:       append([]string{"get-token", "--gangway-url", cfg.ExecCredentialURL()}, cfg.ExecCredentialArgs...),
+			InstallHint: fmt.Sprintf(
+				"Install the %s exec-credential plugin and ensure it is on your PATH.", cfg.ExecCredentialCommand,
+			),
+		}
+	} else {
+		authInfo.AuthProvider = &clientcmdapi.AuthProviderConfig{
+			Name: "oidc",
+			Config: map[string]string{
+				"client-id":      info.ClientID,
+				"client-secret":  info.ClientSecret,
+				"id-token":       info.IDToken,
+				"idp-issuer-url": info.IssuerURL,
+				"refresh-token":  info.RefreshToken,
+			},
+		}
 	}
+
 	// fill out kubeconfig structure
 	kcfg := clientcmdapi.Config{
 		Kind:           "Config",
 		APIVersion:     "v1",
-		CurrentContext: cfg.ClusterName,
-		Clusters:       cfg.Clusters,
+		CurrentContext: info.ClusterName,
+		Clusters:       info.Clusters,
 		Contexts:       contexts,
 		AuthInfos: []clientcmdapi.NamedAuthInfo{
 			{
-				Name: cfg.KubeCfgUser,
-				AuthInfo: clientcmdapi.AuthInfo{
-					AuthProvider: &clientcmdapi.AuthProviderConfig{
-						Name: "oidc",
-						Config: map[string]string{
-							"client-id":      cfg.ClientID,
-							"client-secret":  cfg.ClientSecret,
-							"id-token":       cfg.IDToken,
-							"idp-issuer-url": cfg.IssuerURL,
-							"refresh-token":  cfg.RefreshToken,
-						},
-					},
-				},
+				Name:     info.KubeCfgUser,
+				AuthInfo: authInfo,
 			},
 		},
 	}
 	return kcfg
 }
 
+// generateCodeVerifier returns a cryptographically-random string suitable for
+// use as a PKCE code_verifier, per RFC 7636 section 4.1.
+func generateCodeVerifier() (string, error) {
+	b := make([]byte, pkceVerifierLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// generateCodeChallengeS256 derives the PKCE code_challenge for the
+// "S256" transform: base64url(SHA256(code_verifier)), without padding.
+func generateCodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 func loginRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := gangwayUserSession.Session.Get(r, "gangway_id_token")
+		session, err := gangwayUserSession.Get(r, "gangway_id_token")
 		if err != nil {
 			http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
 			return
@@ -155,6 +367,17 @@ func loginRequired(next http.Handler) http.Handler {
 			return
 		}
 
+		// When WebAuthn step-up auth is enabled, OIDC SSO alone isn't
+		// enough to download a kubeconfig: the browser must also have
+		// completed a hardware-backed assertion this session.
+		if cfg.WebAuthnRequired {
+			gangwaySession, err := gangwayUserSession.Get(r, "gangway")
+			if err != nil || gangwaySession.Values["webauthn_verified"] != true {
+				http.Redirect(w, r, fmt.Sprintf("%s/webauthn/login", cfg.HTTPPath), http.StatusTemporaryRedirect)
+				return
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -164,16 +387,36 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		HTTPPath: cfg.HTTPPath,
 	}
 
+	if err := ensureProviders(); err != nil {
+		log.Errorf("Failed to load OIDC providers: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only surface the IdP chooser once there's actually a choice to make;
+	// a single-provider deployment goes straight to /login as before.
+	if len(providers) > 1 {
+		for _, p := range providers {
+			data.Providers = append(data.Providers, providerInfo{ID: p.ID, Name: p.Name})
+		}
+		sort.Slice(data.Providers, func(i, j int) bool { return data.Providers[i].ID < data.Providers[j].ID })
+	}
+
 	serveTemplate("home.tmpl", data, w)
 }
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := resolveProvider(r.URL.Query().Get("provider"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	b := make([]byte, 32)
 	rand.Read(b)
 	state := base64.StdEncoding.EncodeToString(b)
 
-	session, err := gangwayUserSession.Session.Get(r, "gangway")
+	session, err := gangwayUserSession.Get(r, "gangway")
 	if err != nil {
 		log.Errorf("Got an error in login: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -181,42 +424,358 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	session.Values["state"] = state
+	session.Values["provider"] = provider.ID
+
+	authCodeOpts := []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("audience", provider.Audience)}
+
+	if cfg.PKCEMethod == pkceMethodPlain || cfg.PKCEMethod == pkceMethodS256 {
+		verifier, err := generateCodeVerifier()
+		if err != nil {
+			log.Errorf("Failed to generate PKCE code_verifier: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		session.Values["code_verifier"] = verifier
+
+		challenge := verifier
+		if cfg.PKCEMethod == pkceMethodS256 {
+			challenge = generateCodeChallengeS256(verifier)
+		}
+		authCodeOpts = append(authCodeOpts,
+			oauth2.SetAuthURLParam("code_challenge", challenge),
+			oauth2.SetAuthURLParam("code_challenge_method", cfg.PKCEMethod),
+		)
+	}
+
 	err = session.Save(r, w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	audience := oauth2.SetAuthURLParam("audience", cfg.Audience)
-	url := oauth2Cfg.AuthCodeURL(state, audience)
+	url := provider.OAuth2Config.AuthCodeURL(state, authCodeOpts...)
 
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+// logoutHandler clears the local gangway session and, unless disabled in
+// config, performs an RP-initiated logout against the IdP so that the
+// user's IdP session is also terminated.
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
-	gangwayUserSession.Cleanup(w, r, "gangway")
+	var idToken, providerID string
+	if sessionIDToken, err := gangwayUserSession.Get(r, "gangway_id_token"); err == nil {
+		idToken, _ = sessionIDToken.Values["id_token"].(string)
+		providerID, _ = sessionIDToken.Values["provider"].(string)
+	}
+
 	gangwayUserSession.Cleanup(w, r, "gangway_id_token")
 	gangwayUserSession.Cleanup(w, r, "gangway_refresh_token")
+
+	if cfg.SkipIDPLogout || idToken == "" {
+		gangwayUserSession.Cleanup(w, r, "gangway")
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	provider, err := resolveProvider(providerID)
+	if err != nil {
+		log.Warnf("Could not resolve provider for RP-initiated logout, falling back to local logout: %s", err)
+		gangwayUserSession.Cleanup(w, r, "gangway")
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	jwtToken, err := oidc.ParseToken(idToken, provider.OAuth2Config.ClientSecret)
+	if err != nil {
+		log.Warnf("Could not parse id_token for RP-initiated logout, falling back to local logout: %s", err)
+		gangwayUserSession.Cleanup(w, r, "gangway")
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	issuerURL, _ := claims["iss"].(string)
+
+	doc, err := oidc.Discover(transportConfig.HTTPClient, issuerURL)
+	if err != nil || doc.EndSessionEndpoint == "" {
+		log.Warnf("IdP at %s does not support RP-initiated logout, falling back to local logout: %v", issuerURL, err)
+		gangwayUserSession.Cleanup(w, r, "gangway")
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	state := base64.StdEncoding.EncodeToString(b)
+
+	// Keep the "gangway" session alive just long enough to verify the
+	// state round-trip in postLogoutHandler.
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["logout_state"] = state
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	endSessionURL, err := url.Parse(doc.EndSessionEndpoint)
+	if err != nil {
+		log.Errorf("Could not parse end_session_endpoint %q: %s", doc.EndSessionEndpoint, err)
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+	q := endSessionURL.Query()
+	q.Set("id_token_hint", idToken)
+	q.Set("post_logout_redirect_uri", cfg.PostLogoutRedirectURI)
+	q.Set("state", state)
+	endSessionURL.RawQuery = q.Encode()
+
+	http.Redirect(w, r, endSessionURL.String(), http.StatusTemporaryRedirect)
+}
+
+// postLogoutHandler is the target of post_logout_redirect_uri. It validates
+// the state that logoutHandler stashed before the IdP round-trip, then
+// finishes clearing the local session.
+func postLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		gangwayUserSession.Cleanup(w, r, "gangway")
+		http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	expected, ok := session.Values["logout_state"].(string)
+	state := r.URL.Query().Get("state")
+
+	gangwayUserSession.Cleanup(w, r, "gangway")
+
+	if !ok || state == "" || state != expected {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
 	http.Redirect(w, r, cfg.GetRootPathPrefix(), http.StatusTemporaryRedirect)
 }
 
+// subjectFromIDToken returns the OIDC `sub` and username claims of the
+// session's current id_token, for use as the WebAuthn user handle. It does
+// not check webauthn_verified, since it is also used to drive the ceremony
+// that sets that flag in the first place.
+func subjectFromIDToken(r *http.Request) (sub, username string, err error) {
+	sessionIDToken, err := gangwayUserSession.Get(r, "gangway_id_token")
+	if err != nil {
+		return "", "", err
+	}
+
+	idToken, ok := sessionIDToken.Values["id_token"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("no id_token in session")
+	}
+
+	providerID, _ := sessionIDToken.Values["provider"].(string)
+	provider, err := resolveProvider(providerID)
+	if err != nil {
+		return "", "", err
+	}
+
+	jwtToken, err := oidc.ParseToken(idToken, provider.OAuth2Config.ClientSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("could not parse JWT: %s", err)
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+
+	sub, ok = claims["sub"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("could not parse sub claim")
+	}
+	username, _ = claims[provider.UsernameClaim].(string)
+
+	return sub, username, nil
+}
+
+// webauthnLoginPageHandler serves the page that drives the browser-side
+// WebAuthn assertion ceremony against webauthnLoginBeginHandler and
+// webauthnLoginFinishHandler. loginRequired redirects here when
+// cfg.WebAuthnRequired is set and the session hasn't completed one yet.
+func webauthnLoginPageHandler(w http.ResponseWriter, r *http.Request) {
+	data := &homeInfo{
+		HTTPPath: cfg.HTTPPath,
+	}
+
+	serveTemplate("webauthn.tmpl", data, w)
+}
+
+// webauthnRegisterBeginHandler starts a credential-creation ceremony for the
+// signed-in OIDC subject and hands the resulting CredentialCreation options
+// to the browser's navigator.credentials.create() call.
+func webauthnRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	sub, username, err := subjectFromIDToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	optionsJSON, sessionDataJSON, err := webauthnManager.BeginRegistration(sub, username)
+	if err != nil {
+		log.Errorf("Failed to begin webauthn registration: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["webauthn_session_data"] = string(sessionDataJSON)
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(optionsJSON)
+}
+
+// webauthnRegisterFinishHandler validates the browser's attestation
+// response against the ceremony started by webauthnRegisterBeginHandler and
+// persists the new credential.
+func webauthnRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	sub, username, err := subjectFromIDToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessionDataJSON, ok := session.Values["webauthn_session_data"].(string)
+	if !ok {
+		http.Error(w, "No in-progress webauthn ceremony", http.StatusForbidden)
+		return
+	}
+
+	if err := webauthnManager.FinishRegistration(sub, username, []byte(sessionDataJSON), r); err != nil {
+		log.Errorf("Failed to finish webauthn registration: %s", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	delete(session.Values, "webauthn_session_data")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// webauthnLoginBeginHandler starts an assertion ceremony against the
+// credential(s) already registered for the signed-in OIDC subject.
+func webauthnLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	sub, _, err := subjectFromIDToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	optionsJSON, sessionDataJSON, err := webauthnManager.BeginLogin(sub)
+	if err != nil {
+		log.Errorf("Failed to begin webauthn login: %s", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["webauthn_session_data"] = string(sessionDataJSON)
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(optionsJSON)
+}
+
+// webauthnLoginFinishHandler validates the browser's assertion response
+// against the ceremony started by webauthnLoginBeginHandler. On success it
+// sets the webauthn_verified session flag that loginRequired checks.
+func webauthnLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	sub, _, err := subjectFromIDToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := gangwayUserSession.Get(r, "gangway")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessionDataJSON, ok := session.Values["webauthn_session_data"].(string)
+	if !ok {
+		http.Error(w, "No in-progress webauthn ceremony", http.StatusForbidden)
+		return
+	}
+
+	if err := webauthnManager.FinishLogin(sub, []byte(sessionDataJSON), r); err != nil {
+		log.Errorf("Failed to finish webauthn login: %s", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	delete(session.Values, "webauthn_session_data")
+	session.Values["webauthn_verified"] = true
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// callbackHandler is mounted once per configured provider, at
+// /callback/{provider}, so multi-IdP deployments can tell which provider's
+// config to use for the token exchange. A bare /callback (no mux var)
+// falls back to the provider chosen in loginHandler, for single-provider
+// deployments and IdPs that can't be configured with a per-provider
+// redirect_uri.
 func callbackHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, transportConfig.HTTPClient)
 
 	// load up session cookies
-	session, err := gangwayUserSession.Session.Get(r, "gangway")
+	session, err := gangwayUserSession.Get(r, "gangway")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	sessionIDToken, err := gangwayUserSession.Session.Get(r, "gangway_id_token")
+	providerID := mux.Vars(r)["provider"]
+	if providerID == "" {
+		providerID, _ = session.Values["provider"].(string)
+	}
+	provider, err := resolveProvider(providerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionIDToken, err := gangwayUserSession.Get(r, "gangway_id_token")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	sessionRefreshToken, err := gangwayUserSession.Session.Get(r, "gangway_refresh_token")
+	sessionRefreshToken, err := gangwayUserSession.Get(r, "gangway_refresh_token")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -232,13 +791,25 @@ func callbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// use the access code to retrieve a token
 	code := r.URL.Query().Get("code")
-	token, err := o2token.Exchange(ctx, code)
+
+	exchangeOpts := []oauth2.AuthCodeOption{}
+	if cfg.PKCEMethod == pkceMethodPlain || cfg.PKCEMethod == pkceMethodS256 {
+		verifier, ok := session.Values["code_verifier"].(string)
+		if !ok {
+			http.Error(w, "Missing PKCE code_verifier in session", http.StatusForbidden)
+			return
+		}
+		exchangeOpts = append(exchangeOpts, oauth2.SetAuthURLParam("code_verifier", verifier))
+	}
+
+	token, err := provider.OAuth2Config.Exchange(ctx, code, exchangeOpts...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	sessionIDToken.Values["id_token"] = token.Extra("id_token")
+	sessionIDToken.Values["provider"] = provider.ID
 	sessionRefreshToken.Values["refresh_token"] = token.RefreshToken
 
 	// save the session cookies
@@ -292,6 +863,166 @@ func kubeConfigHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(d)
 }
 
+// refreshHandler lets a kubectl exec-plugin (or any other non-browser
+// client holding a gangway session) mint a fresh id_token from the
+// stored refresh_token, without re-running the browser-based login flow.
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	info := generateInfo(w, r)
+	if info == nil {
+		// generateInfo writes to the ResponseWriter if it encounters an error.
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+	}{
+		IDToken:      info.IDToken,
+		RefreshToken: info.RefreshToken,
+	})
+}
+
+// execCredentialHandler serves a client.authentication.k8s.io/v1beta1
+// ExecCredential, for use by the gangway client-go exec-plugin configured
+// via generateKubeConfig's exec-credential mode. Unlike a static
+// kubeconfig, the plugin calls this endpoint on every kubectl invocation,
+// so the token it hands to the API server is always fresh.
+func execCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	info := generateInfo(w, r)
+	if info == nil {
+		// generateInfo writes to the ResponseWriter if it encounters an error.
+		return
+	}
+
+	expiresAt, err := tokenmgr.ExpiresAt(info.IDToken)
+	if err != nil {
+		log.Errorf("Could not parse id_token expiry for exec-credential: %s", err)
+		http.Error(w, "Could not parse id_token expiry", http.StatusInternalServerError)
+		return
+	}
+
+	cred := clientauthenticationv1beta1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ExecCredential",
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+		},
+		Status: &clientauthenticationv1beta1.ExecCredentialStatus{
+			Token:               info.IDToken,
+			ExpirationTimestamp: &metav1.Time{Time: expiresAt},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cred); err != nil {
+		log.Errorf("Error encoding exec-credential response - %s", err.Error())
+	}
+}
+
+// groupsFromClaims resolves claimPath against claims and returns the
+// matching list of group names. claimPath is dot-separated so that it can
+// reach into nested claims, e.g. Keycloak's
+// "resource_access.<client>.roles", not just a top-level array claim like
+// "groups".
+func groupsFromClaims(claims jwt.MapClaims, claimPath string) []string {
+	if claimPath == "" {
+		return nil
+	}
+
+	var cur interface{} = map[string]interface{}(claims)
+	for _, segment := range strings.Split(claimPath, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur, ok = m[segment]
+		if !ok {
+			return nil
+		}
+	}
+
+	raw, ok := cur.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	groups := make([]string, 0, len(raw))
+	for _, g := range raw {
+		if s, ok := g.(string); ok {
+			groups = append(groups, s)
+		}
+	}
+	return groups
+}
+
+// hasAnyGroup reports whether userGroups and allowed share any member. It
+// does not special-case an empty allowed list: callers that mean "no
+// restriction" by an empty list (e.g. cfg.RequiredGroups) must check that
+// themselves, since for per-cluster authorization an empty/missing list
+// means the opposite - nobody is allowed.
+func hasAnyGroup(userGroups, allowed []string) bool {
+	for _, u := range userGroups {
+		for _, a := range allowed {
+			if u == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorizedClusters filters cfg.Clusters (the optional supplementary
+// cluster list) down to the ones userGroups may access, per the
+// clusterName -> allowedGroups mapping in cfg.ClusterGroups. Once
+// cfg.ClusterGroups is configured at all, a cluster with no entry in it is
+// denied by default, not silently left open - an operator who lists three
+// clusters and forgets a fourth gets a visible gap, not a quiet bypass.
+func authorizedClusters(userGroups []string) []clientcmdapi.NamedCluster {
+	if len(cfg.ClusterGroups) == 0 {
+		return cfg.Clusters
+	}
+
+	var allowed []clientcmdapi.NamedCluster
+	for _, c := range cfg.Clusters {
+		groups, ok := cfg.ClusterGroups[c.Name]
+		if !ok {
+			log.Warnf("cluster %q has no entry in ClusterGroups; denying access by default", c.Name)
+			continue
+		}
+		if hasAnyGroup(userGroups, groups) {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed
+}
+
+// homeClusterAuthorized reports whether userGroups may access cfg.Clusters'
+// implicit "home" cluster (ClusterName/APIServerURL/ClusterCA), which
+// generateKubeConfig synthesizes separately and so isn't covered by
+// authorizedClusters. It follows the same default as authorizedClusters:
+// open when cfg.ClusterGroups isn't configured at all, denied by default if
+// it is configured but has no entry for cfg.ClusterName.
+func homeClusterAuthorized(userGroups []string) bool {
+	if len(cfg.ClusterGroups) == 0 {
+		return true
+	}
+
+	groups, ok := cfg.ClusterGroups[cfg.ClusterName]
+	if !ok {
+		log.Warnf("home cluster %q has no entry in ClusterGroups; denying access by default", cfg.ClusterName)
+		return false
+	}
+	return hasAnyGroup(userGroups, groups)
+}
+
+// serveAccessDenied renders the access-denied page for a user whose groups
+// don't authorize them for anything, instead of handing out a kubeconfig
+// with no usable clusters in it.
+func serveAccessDenied(w http.ResponseWriter, groups []string) {
+	w.WriteHeader(http.StatusForbidden)
+	serveTemplate("access-denied.tmpl", &accessDeniedInfo{HTTPPath: cfg.HTTPPath, Groups: groups}, w)
+}
+
 func generateInfo(w http.ResponseWriter, r *http.Request) *userInfo {
 	// read in public ca.crt to output in commandline copy/paste commands
 	file, err := os.Open(cfg.ClusterCAPath)
@@ -307,12 +1038,12 @@ func generateInfo(w http.ResponseWriter, r *http.Request) *userInfo {
 	}
 
 	// load the session cookies
-	sessionIDToken, err := gangwayUserSession.Session.Get(r, "gangway_id_token")
+	sessionIDToken, err := gangwayUserSession.Get(r, "gangway_id_token")
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return nil
 	}
-	sessionRefreshToken, err := gangwayUserSession.Session.Get(r, "gangway_refresh_token")
+	sessionRefreshToken, err := gangwayUserSession.Get(r, "gangway_refresh_token")
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return nil
@@ -338,14 +1069,56 @@ func generateInfo(w http.ResponseWriter, r *http.Request) *userInfo {
 		return nil
 	}
 
-	jwtToken, err := oidc.ParseToken(idToken, cfg.ClientSecret)
+	providerID, _ := sessionIDToken.Values["provider"].(string)
+	provider, err := resolveProvider(providerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	// Transparently rotate the id_token (and, if the IdP issues one, the
+	// refresh_token) before it's handed out, so callers never receive a
+	// token that's already on its way out.
+	if cfg.RefreshSkewWindow > 0 {
+		mgr := tokenmgr.NewManager(provider.OAuth2Config, cfg.RefreshSkewWindow)
+		needsRefresh, err := mgr.NeedsRefresh(idToken)
+		if err != nil {
+			log.Warnf("Could not determine id_token expiry, skipping refresh: %s", err)
+		} else if needsRefresh {
+			ctx := context.WithValue(r.Context(), oauth2.HTTPClient, transportConfig.HTTPClient)
+			newIDToken, newRefreshToken, err := mgr.Refresh(ctx, refreshToken)
+			if err != nil {
+				log.Warnf("Failed to refresh id_token, redirecting to re-authenticate: %s", err)
+				gangwayUserSession.Cleanup(w, r, "gangway")
+				gangwayUserSession.Cleanup(w, r, "gangway_id_token")
+				gangwayUserSession.Cleanup(w, r, "gangway_refresh_token")
+				http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+				return nil
+			}
+
+			idToken = newIDToken
+			refreshToken = newRefreshToken
+			sessionIDToken.Values["id_token"] = idToken
+			sessionRefreshToken.Values["refresh_token"] = refreshToken
+			if err := sessionIDToken.Save(r, w); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return nil
+			}
+			if err := sessionRefreshToken.Save(r, w); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return nil
+			}
+		}
+	}
+
+	jwtToken, err := oidc.ParseToken(idToken, provider.OAuth2Config.ClientSecret)
 	if err != nil {
 		http.Error(w, "Could not parse JWT", http.StatusInternalServerError)
 		return nil
 	}
 
 	claims := jwtToken.Claims.(jwt.MapClaims)
-	username, ok := claims[cfg.UsernameClaim].(string)
+	username, ok := claims[provider.UsernameClaim].(string)
 	if !ok {
 		http.Error(w, "Could not parse Username claim", http.StatusInternalServerError)
 		return nil
@@ -363,23 +1136,39 @@ func generateInfo(w http.ResponseWriter, r *http.Request) *userInfo {
 		return nil
 	}
 
-	if cfg.ClientSecret == "" {
+	if provider.OAuth2Config.ClientSecret == "" {
 		log.Warn("Setting an empty Client Secret should only be done if you have no other option and is an inherent security risk.")
 	}
 
+	groups := groupsFromClaims(claims, cfg.GroupsClaim)
+
+	if len(cfg.RequiredGroups) > 0 && !hasAnyGroup(groups, cfg.RequiredGroups) {
+		serveAccessDenied(w, groups)
+		return nil
+	}
+
+	clusters := authorizedClusters(groups)
+	homeAllowed := homeClusterAuthorized(groups)
+	if len(clusters) == 0 && !homeAllowed {
+		serveAccessDenied(w, groups)
+		return nil
+	}
+
 	info := &userInfo{
-		ClusterName:  cfg.ClusterName,
-		Username:     username,
-		KubeCfgUser:  kubeCfgUser,
-		IDToken:      idToken,
-		RefreshToken: refreshToken,
-		ClientID:     cfg.ClientID,
-		ClientSecret: cfg.ClientSecret,
-		IssuerURL:    issuerURL,
-		APIServerURL: cfg.APIServerURL,
-		ClusterCA:    string(caBytes),
-		HTTPPath:     cfg.HTTPPath,
-		Clusters:     cfg.Clusters,
+		ClusterName:           cfg.ClusterName,
+		Username:              username,
+		KubeCfgUser:           kubeCfgUser,
+		IDToken:               idToken,
+		RefreshToken:          refreshToken,
+		ClientID:              provider.OAuth2Config.ClientID,
+		ClientSecret:          provider.OAuth2Config.ClientSecret,
+		IssuerURL:             issuerURL,
+		APIServerURL:          cfg.APIServerURL,
+		ClusterCA:             string(caBytes),
+		HTTPPath:              cfg.HTTPPath,
+		Clusters:              clusters,
+		Groups:                groups,
+		HomeClusterAuthorized: homeAllowed,
 	}
 	return info
 }
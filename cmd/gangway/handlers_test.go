@@ -0,0 +1,65 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatalf("generateCodeVerifier returned an error: %s", err)
+	}
+
+	if l := len(verifier); l < 43 || l > 128 {
+		t.Fatalf("verifier length %d is outside the 43-128 characters required by RFC 7636", l)
+	}
+
+	for _, r := range verifier {
+		if !strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_", r) {
+			t.Fatalf("verifier %q contains a character outside the RFC 7636 unreserved set: %q", verifier, r)
+		}
+	}
+
+	second, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatalf("generateCodeVerifier returned an error: %s", err)
+	}
+	if verifier == second {
+		t.Fatal("two calls to generateCodeVerifier returned the same value")
+	}
+}
+
+func TestGenerateCodeChallengeS256(t *testing.T) {
+	// Test vector from RFC 7636 Appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := generateCodeChallengeS256(verifier); got != want {
+		t.Fatalf("generateCodeChallengeS256(%q) = %q, want %q", verifier, got, want)
+	}
+}
+
+func TestGenerateCodeChallengeS256_MismatchedVerifier(t *testing.T) {
+	// A code_challenge derived from one verifier must not validate a
+	// token exchange that supplies a different one - this is the
+	// property the IdP relies on to detect a stolen authorization code.
+	challenge := generateCodeChallengeS256("correct-verifier")
+	if got := generateCodeChallengeS256("wrong-verifier"); got == challenge {
+		t.Fatal("generateCodeChallengeS256 produced the same challenge for two different verifiers")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryCacheTTL controls how long a fetched discovery document is
+// reused before being re-fetched from the issuer.
+const discoveryCacheTTL = 1 * time.Hour
+
+// DiscoveryDocument is the subset of an OIDC provider's
+// `.well-known/openid-configuration` document that gangway cares about.
+type DiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type cachedDocument struct {
+	doc       *DiscoveryDocument
+	expiresAt time.Time
+}
+
+var (
+	discoveryMu    sync.RWMutex
+	discoveryCache = map[string]cachedDocument{}
+)
+
+// Discover fetches and caches the OIDC discovery document for the given
+// issuer URL. Subsequent calls for the same issuer are served from an
+// in-memory cache until discoveryCacheTTL elapses.
+func Discover(client *http.Client, issuerURL string) (*DiscoveryDocument, error) {
+	discoveryMu.RLock()
+	cached, ok := discoveryCache[issuerURL]
+	discoveryMu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.doc, nil
+	}
+
+	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	resp, err := client.Get(wellKnown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery document request to %s returned status %d", wellKnown, resp.StatusCode)
+	}
+
+	doc := &DiscoveryDocument{}
+	if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %s", err)
+	}
+
+	discoveryMu.Lock()
+	discoveryCache[issuerURL] = cachedDocument{doc: doc, expiresAt: time.Now().Add(discoveryCacheTTL)}
+	discoveryMu.Unlock()
+
+	return doc, nil
+}
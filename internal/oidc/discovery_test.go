@@ -0,0 +1,124 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeDiscoveryServer serves a `.well-known/openid-configuration` document
+// and counts how many times it was hit, so tests can assert on caching.
+func fakeDiscoveryServer(t *testing.T, doc string) (*httptest.Server, *int) {
+	t.Helper()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, doc)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &hits
+}
+
+func TestDiscover(t *testing.T) {
+	srv, hits := fakeDiscoveryServer(t, `{
+		"issuer": "https://idp.example.com",
+		"authorization_endpoint": "https://idp.example.com/auth",
+		"token_endpoint": "https://idp.example.com/token",
+		"end_session_endpoint": "https://idp.example.com/logout",
+		"jwks_uri": "https://idp.example.com/jwks"
+	}`)
+
+	doc, err := Discover(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("Discover returned an error: %s", err)
+	}
+
+	if doc.AuthorizationEndpoint != "https://idp.example.com/auth" {
+		t.Errorf("AuthorizationEndpoint = %q, want %q", doc.AuthorizationEndpoint, "https://idp.example.com/auth")
+	}
+	if doc.TokenEndpoint != "https://idp.example.com/token" {
+		t.Errorf("TokenEndpoint = %q, want %q", doc.TokenEndpoint, "https://idp.example.com/token")
+	}
+	if doc.EndSessionEndpoint != "https://idp.example.com/logout" {
+		t.Errorf("EndSessionEndpoint = %q, want %q", doc.EndSessionEndpoint, "https://idp.example.com/logout")
+	}
+
+	if *hits != 1 {
+		t.Fatalf("expected 1 request to the discovery endpoint, got %d", *hits)
+	}
+}
+
+func TestDiscover_CachesDocument(t *testing.T) {
+	srv, hits := fakeDiscoveryServer(t, `{"issuer": "https://idp.example.com"}`)
+
+	if _, err := Discover(srv.Client(), srv.URL); err != nil {
+		t.Fatalf("Discover returned an error: %s", err)
+	}
+	if _, err := Discover(srv.Client(), srv.URL); err != nil {
+		t.Fatalf("Discover returned an error: %s", err)
+	}
+
+	if *hits != 1 {
+		t.Fatalf("expected the second Discover call to be served from cache, got %d requests", *hits)
+	}
+}
+
+func TestDiscover_NoEndSessionEndpoint(t *testing.T) {
+	// logoutHandler falls back to a local-only logout when the IdP
+	// doesn't support RP-initiated logout; that's signalled by an empty
+	// EndSessionEndpoint, not an error.
+	srv, _ := fakeDiscoveryServer(t, `{
+		"issuer": "https://idp.example.com",
+		"authorization_endpoint": "https://idp.example.com/auth",
+		"token_endpoint": "https://idp.example.com/token"
+	}`)
+
+	doc, err := Discover(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("Discover returned an error: %s", err)
+	}
+	if doc.EndSessionEndpoint != "" {
+		t.Errorf("EndSessionEndpoint = %q, want empty", doc.EndSessionEndpoint)
+	}
+}
+
+func TestDiscover_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	if _, err := Discover(srv.Client(), srv.URL); err == nil {
+		t.Fatal("expected an error for a 404 discovery response, got nil")
+	}
+}
+
+func TestDiscover_MalformedJSON(t *testing.T) {
+	srv, _ := fakeDiscoveryServer(t, `not json`)
+
+	if _, err := Discover(srv.Client(), srv.URL); err == nil {
+		t.Fatal("expected an error for a malformed discovery document, got nil")
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// cookieStore is gangway's original session backend: the entire session
+// is encrypted and stored client-side, so it has no server-side record
+// to revoke.
+type cookieStore struct {
+	store *sessions.CookieStore
+}
+
+func newCookieStore(cfg Config) *cookieStore {
+	store := sessions.NewCookieStore(cfg.AuthKey, cfg.EncryptionKey)
+	store.Options.MaxAge = cfg.MaxAge
+	return &cookieStore{store: store}
+}
+
+func (c *cookieStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return c.store.Get(r, name)
+}
+
+func (c *cookieStore) Cleanup(w http.ResponseWriter, r *http.Request, name string) error {
+	s, err := c.store.Get(r, name)
+	if err != nil {
+		return err
+	}
+	invalidate(s)
+	return s.Save(r, w)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieStore_Cleanup(t *testing.T) {
+	store := newCookieStore(Config{
+		AuthKey: []byte("0123456789abcdef0123456789abcdef"),
+		MaxAge:  3600,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, err := store.Get(r, "gangway")
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err)
+	}
+	s.Values["id_token"] = "some-token"
+
+	w := httptest.NewRecorder()
+	if err := store.Cleanup(w, r, "gangway"); err != nil {
+		t.Fatalf("Cleanup returned an error: %s", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected Cleanup to set exactly one cookie, got %d", len(cookies))
+	}
+	if cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected Cleanup's cookie to have a negative MaxAge, got %d", cookies[0].MaxAge)
+	}
+}
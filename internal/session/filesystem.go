@@ -0,0 +1,60 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/sessions"
+)
+
+// filesystemStore keeps the session payload in a file on local disk,
+// keyed by a small opaque ID cookie. It avoids the cookie size limits
+// that large id_token/refresh_token pairs can hit, but does not share
+// state across replicas.
+type filesystemStore struct {
+	store *sessions.FilesystemStore
+}
+
+func newFilesystemStore(cfg Config) (*filesystemStore, error) {
+	if cfg.StoragePath == "" {
+		return nil, fmt.Errorf("session: filesystem backend requires a storage path")
+	}
+	if err := os.MkdirAll(cfg.StoragePath, 0700); err != nil {
+		return nil, fmt.Errorf("session: failed to create storage path %q: %s", cfg.StoragePath, err)
+	}
+
+	store := sessions.NewFilesystemStore(cfg.StoragePath, cfg.AuthKey, cfg.EncryptionKey)
+	store.MaxLength(0)
+	store.Options.MaxAge = cfg.MaxAge
+	return &filesystemStore{store: store}, nil
+}
+
+func (f *filesystemStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return f.store.Get(r, name)
+}
+
+func (f *filesystemStore) Cleanup(w http.ResponseWriter, r *http.Request, name string) error {
+	s, err := f.store.Get(r, name)
+	if err != nil {
+		return err
+	}
+	invalidate(s)
+	// Saving with a negative MaxAge tells FilesystemStore to delete the
+	// backing file, so the session cannot be replayed afterwards.
+	return s.Save(r, w)
+}
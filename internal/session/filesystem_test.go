@@ -0,0 +1,72 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFilesystemStore_Cleanup(t *testing.T) {
+	storagePath := t.TempDir()
+	store, err := newFilesystemStore(Config{
+		AuthKey:     []byte("0123456789abcdef0123456789abcdef"),
+		StoragePath: storagePath,
+		MaxAge:      3600,
+	})
+	if err != nil {
+		t.Fatalf("newFilesystemStore returned an error: %s", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, err := store.Get(r, "gangway")
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err)
+	}
+	s.Values["id_token"] = "some-token"
+
+	w := httptest.NewRecorder()
+	if err := s.Save(r, w); err != nil {
+		t.Fatalf("Save returned an error: %s", err)
+	}
+
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		t.Fatalf("failed to read storage path: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected Save to write one session file, found %d", len(entries))
+	}
+
+	// Replay the session cookie the first Save issued, so Cleanup acts on
+	// the same backing file rather than creating a new session.
+	r2 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r2.AddCookie(w.Result().Cookies()[0])
+
+	w2 := httptest.NewRecorder()
+	if err := store.Cleanup(w2, r2, "gangway"); err != nil {
+		t.Fatalf("Cleanup returned an error: %s", err)
+	}
+
+	entries, err = os.ReadDir(storagePath)
+	if err != nil {
+		t.Fatalf("failed to read storage path: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected Cleanup to delete the backing file, %d remain", len(entries))
+	}
+}
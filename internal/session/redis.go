@@ -0,0 +1,91 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/boj/redistore"
+	"github.com/gorilla/sessions"
+)
+
+// redisStore keeps the session payload in Redis, keyed by a small opaque
+// ID cookie. This is the recommended backend for multi-replica
+// deployments: every replica sees the same store, and Cleanup actually
+// deletes the server-side record, giving real revocation even if a
+// cookie is captured.
+type redisStore struct {
+	store *redistore.RediStore
+}
+
+func newRedisStore(cfg Config) (*redisStore, error) {
+	if cfg.RedisURL == "" {
+		return nil, fmt.Errorf("session: redis backend requires a redis URL")
+	}
+
+	addr, err := redisAddr(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("session: %s", err)
+	}
+
+	store, err := redistore.NewRediStoreWithPassword(10, "tcp", addr, cfg.RedisPassword, cfg.AuthKey, cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("session: failed to connect to redis at %q: %s", addr, err)
+	}
+	store.SetMaxAge(cfg.MaxAge)
+
+	return &redisStore{store: store}, nil
+}
+
+// redisAddr turns cfg.RedisURL into the host:port address redistore
+// dials. It accepts both a bare "host:port" and a "redis://host:port"
+// (or "rediss://host:port") URL, since the RedisURL field name implies
+// the latter is acceptable.
+func redisAddr(raw string) (string, error) {
+	if !strings.Contains(raw, "://") {
+		return raw, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid redis URL %q: %s", raw, err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return "", fmt.Errorf("unsupported redis URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("redis URL %q has no host", raw)
+	}
+
+	return u.Host, nil
+}
+
+func (r *redisStore) Get(req *http.Request, name string) (*sessions.Session, error) {
+	return r.store.Get(req, name)
+}
+
+func (r *redisStore) Cleanup(w http.ResponseWriter, req *http.Request, name string) error {
+	s, err := r.store.Get(req, name)
+	if err != nil {
+		return err
+	}
+	invalidate(s)
+	// Saving with a negative MaxAge tells redistore to delete the key
+	// from Redis, not just expire the cookie.
+	return s.Save(req, w)
+}
@@ -0,0 +1,49 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import "testing"
+
+func TestRedisAddr(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"bare host:port", "localhost:6379", "localhost:6379", false},
+		{"redis scheme", "redis://localhost:6379", "localhost:6379", false},
+		{"rediss scheme", "rediss://redis.internal:6380", "redis.internal:6380", false},
+		{"unsupported scheme", "http://localhost:6379", "", true},
+		{"no host", "redis://", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := redisAddr(c.in)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("redisAddr(%q) = %q, want an error", c.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("redisAddr(%q) returned an error: %s", c.in, err)
+			}
+			if got != c.want {
+				t.Fatalf("redisAddr(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
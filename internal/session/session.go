@@ -0,0 +1,102 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session abstracts the gorilla/sessions backend gangway uses to
+// persist its own session cookies, so that deployments can switch between
+// cookie, filesystem, and Redis storage without touching the handlers
+// that consume it.
+package session
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// BackendCookie stores the full session, encrypted, in the cookie
+	// itself. This is gangway's original behavior and remains the
+	// default; it does not support server-side revocation.
+	BackendCookie = "cookie"
+
+	// BackendFilesystem stores sessions as files on local disk, keyed by
+	// a small ID cookie.
+	BackendFilesystem = "filesystem"
+
+	// BackendRedis stores sessions in Redis, keyed by a small ID cookie.
+	// This is the recommended backend for multi-replica deployments,
+	// since it lets every replica see the same session store and
+	// supports server-side revocation.
+	BackendRedis = "redis"
+)
+
+// Store is implemented by every session backend gangway supports.
+// Handlers should depend on this interface rather than on a concrete
+// gorilla/sessions store, so the backend can be swapped via config.
+type Store interface {
+	// Get returns the named session for the current request, creating a
+	// new, empty session if one does not already exist.
+	Get(r *http.Request, name string) (*sessions.Session, error)
+
+	// Cleanup invalidates the named session both client-side (by
+	// expiring the cookie) and, where the backend supports it,
+	// server-side - so a captured cookie cannot be replayed after
+	// logout.
+	Cleanup(w http.ResponseWriter, r *http.Request, name string) error
+}
+
+// Config selects and configures a session backend.
+type Config struct {
+	// Backend is one of BackendCookie, BackendFilesystem, or
+	// BackendRedis. Defaults to BackendCookie if empty.
+	Backend string
+
+	// AuthKey and EncryptionKey are used to authenticate and encrypt
+	// session data (and, for the cookie backend, the cookie itself).
+	AuthKey       []byte
+	EncryptionKey []byte
+
+	// MaxAge is the session lifetime in seconds.
+	MaxAge int
+
+	// StoragePath is the directory used by BackendFilesystem.
+	StoragePath string
+
+	// RedisURL and RedisPassword configure BackendRedis.
+	RedisURL      string
+	RedisPassword string
+}
+
+// NewStore constructs the Store selected by cfg.Backend.
+func NewStore(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", BackendCookie:
+		return newCookieStore(cfg), nil
+	case BackendFilesystem:
+		return newFilesystemStore(cfg)
+	case BackendRedis:
+		return newRedisStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown session backend: %q", cfg.Backend)
+	}
+}
+
+// invalidate clears a session's values and marks it expired, so that
+// saving it removes both the client-side cookie and, for server-side
+// backends, the stored record.
+func invalidate(s *sessions.Session) {
+	s.Values = make(map[interface{}]interface{})
+	s.Options.MaxAge = -1
+}
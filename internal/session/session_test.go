@@ -0,0 +1,33 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import "testing"
+
+func TestNewStore_UnknownBackend(t *testing.T) {
+	if _, err := NewStore(Config{Backend: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected an error for an unknown backend, got nil")
+	}
+}
+
+func TestNewStore_DefaultsToCookie(t *testing.T) {
+	store, err := NewStore(Config{AuthKey: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("NewStore returned an error: %s", err)
+	}
+	if _, ok := store.(*cookieStore); !ok {
+		t.Fatalf("NewStore with no Backend returned a %T, want *cookieStore", store)
+	}
+}
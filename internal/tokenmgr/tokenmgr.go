@@ -0,0 +1,101 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tokenmgr transparently refreshes expired id_tokens using a
+// stored refresh_token, so that handlers serving kubeconfigs never hand
+// out a token that is about to expire.
+package tokenmgr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// Manager refreshes id_tokens against a single OIDC provider's token
+// endpoint.
+type Manager struct {
+	OAuth2Config *oauth2.Config
+	SkewWindow   time.Duration
+}
+
+// NewManager returns a Manager that refreshes tokens within skewWindow of
+// expiring, using oauth2Config's token endpoint.
+func NewManager(oauth2Config *oauth2.Config, skewWindow time.Duration) *Manager {
+	return &Manager{
+		OAuth2Config: oauth2Config,
+		SkewWindow:   skewWindow,
+	}
+}
+
+// ExpiresAt parses the exp claim out of idToken, without verifying its
+// signature. Signature verification remains the caller's responsibility
+// before the token is trusted for anything else.
+func ExpiresAt(idToken string) (time.Time, error) {
+	parser := &jwt.Parser{}
+	token, _, err := parser.ParseUnverified(idToken, jwt.MapClaims{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse id_token: %s", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return time.Time{}, fmt.Errorf("id_token claims are not a map")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, fmt.Errorf("id_token has no exp claim")
+	}
+
+	return time.Unix(int64(exp), 0), nil
+}
+
+// NeedsRefresh reports whether idToken falls within the configured skew
+// window of expiring.
+func (m *Manager) NeedsRefresh(idToken string) (bool, error) {
+	expiresAt, err := ExpiresAt(idToken)
+	if err != nil {
+		return false, err
+	}
+
+	return time.Now().Add(m.SkewWindow).After(expiresAt), nil
+}
+
+// Refresh exchanges refreshToken for a new id_token via the OIDC
+// provider's `grant_type=refresh_token` flow. It returns the new
+// refresh_token if the IdP rotated it, or the original refreshToken if
+// the IdP returned none (meaning the original is still valid).
+func (m *Manager) Refresh(ctx context.Context, refreshToken string) (idToken string, newRefreshToken string, err error) {
+	ts := m.OAuth2Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken})
+	token, err := ts.Token()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to refresh token: %s", err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", "", fmt.Errorf("refresh response did not include an id_token")
+	}
+
+	rotated := token.RefreshToken
+	if rotated == "" {
+		rotated = refreshToken
+	}
+
+	return raw, rotated, nil
+}
@@ -0,0 +1,164 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmgr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeIDToken builds an unsigned JWT with the given exp claim, which is
+// all ExpiresAt/NeedsRefresh look at.
+func fakeIDToken(t *testing.T, exp time.Time) string {
+	t.Helper()
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{"exp": exp.Unix()})
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %s", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+
+	return fmt.Sprintf("%s.%s.", header, payload)
+}
+
+func TestExpiresAt(t *testing.T) {
+	want := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	got, err := ExpiresAt(fakeIDToken(t, want))
+	if err != nil {
+		t.Fatalf("ExpiresAt returned an error: %s", err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("ExpiresAt = %v, want %v", got, want)
+	}
+}
+
+func TestExpiresAt_Malformed(t *testing.T) {
+	if _, err := ExpiresAt("not-a-jwt"); err == nil {
+		t.Fatal("expected an error for a malformed id_token, got nil")
+	}
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	mgr := &Manager{SkewWindow: 5 * time.Minute}
+
+	cases := []struct {
+		name string
+		exp  time.Time
+		want bool
+	}{
+		{"well within expiry", time.Now().Add(time.Hour), false},
+		{"inside the skew window", time.Now().Add(time.Minute), true},
+		{"already expired", time.Now().Add(-time.Minute), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := mgr.NeedsRefresh(fakeIDToken(t, c.exp))
+			if err != nil {
+				t.Fatalf("NeedsRefresh returned an error: %s", err)
+			}
+			if got != c.want {
+				t.Fatalf("NeedsRefresh = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestManager_Refresh(t *testing.T) {
+	newIDToken := "new-id-token"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse refresh request: %s", err)
+		}
+		if got := r.Form.Get("refresh_token"); got != "old-refresh-token" {
+			t.Fatalf("refresh_token = %q, want %q", got, "old-refresh-token")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "ignored",
+			"id_token":      newIDToken,
+			"refresh_token": "rotated-refresh-token",
+			"token_type":    "Bearer",
+		})
+	}))
+	defer srv.Close()
+
+	mgr := NewManager(&oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}, time.Minute)
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, srv.Client())
+	idToken, refreshToken, err := mgr.Refresh(ctx, "old-refresh-token")
+	if err != nil {
+		t.Fatalf("Refresh returned an error: %s", err)
+	}
+	if idToken != newIDToken {
+		t.Errorf("idToken = %q, want %q", idToken, newIDToken)
+	}
+	if refreshToken != "rotated-refresh-token" {
+		t.Errorf("refreshToken = %q, want %q", refreshToken, "rotated-refresh-token")
+	}
+}
+
+func TestManager_Refresh_KeepsOriginalWhenIdPDoesNotRotate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "ignored",
+			"id_token":     "new-id-token",
+			"token_type":   "Bearer",
+		})
+	}))
+	defer srv.Close()
+
+	mgr := NewManager(&oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}, time.Minute)
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, srv.Client())
+	_, refreshToken, err := mgr.Refresh(ctx, "old-refresh-token")
+	if err != nil {
+		t.Fatalf("Refresh returned an error: %s", err)
+	}
+	if refreshToken != "old-refresh-token" {
+		t.Errorf("refreshToken = %q, want the original %q", refreshToken, "old-refresh-token")
+	}
+}
+
+func TestManager_Refresh_NoIDToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "ignored",
+			"token_type":   "Bearer",
+		})
+	}))
+	defer srv.Close()
+
+	mgr := NewManager(&oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}, time.Minute)
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, srv.Client())
+	if _, _, err := mgr.Refresh(ctx, "old-refresh-token"); err == nil {
+		t.Fatal("expected an error when the refresh response has no id_token, got nil")
+	}
+}
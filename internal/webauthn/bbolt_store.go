@@ -0,0 +1,71 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var usersBucket = []byte("webauthn_users")
+
+// BoltStore is the default Store: a local bbolt file, requiring no
+// external dependency.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a bbolt database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bbolt store at %q: %s", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usersBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize bbolt store: %s", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) GetUser(sub string) (*User, error) {
+	var u *User
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(usersBucket).Get([]byte(sub))
+		if raw == nil {
+			return nil
+		}
+		u = &User{}
+		return json.Unmarshal(raw, u)
+	})
+	return u, err
+}
+
+func (b *BoltStore) SaveUser(u *User) error {
+	raw, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).Put([]byte(u.Sub), raw)
+	})
+}
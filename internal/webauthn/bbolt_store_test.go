@@ -0,0 +1,92 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"path/filepath"
+	"testing"
+
+	gowebauthn "github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestBoltStore_GetUser_NotRegistered(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "webauthn.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore returned an error: %s", err)
+	}
+
+	u, err := store.GetUser("no-such-sub")
+	if err != nil {
+		t.Fatalf("GetUser returned an error: %s", err)
+	}
+	if u != nil {
+		t.Fatalf("GetUser for an unregistered sub = %+v, want nil", u)
+	}
+}
+
+func TestBoltStore_SaveAndGetUser(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "webauthn.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore returned an error: %s", err)
+	}
+
+	want := &User{
+		Sub:      "user-sub",
+		Username: "alice",
+		Credentials: []gowebauthn.Credential{
+			{ID: []byte("cred-id")},
+		},
+	}
+	if err := store.SaveUser(want); err != nil {
+		t.Fatalf("SaveUser returned an error: %s", err)
+	}
+
+	got, err := store.GetUser(want.Sub)
+	if err != nil {
+		t.Fatalf("GetUser returned an error: %s", err)
+	}
+	if got == nil {
+		t.Fatal("GetUser returned nil after SaveUser")
+	}
+	if got.Sub != want.Sub || got.Username != want.Username {
+		t.Fatalf("GetUser = %+v, want %+v", got, want)
+	}
+	if len(got.Credentials) != 1 || string(got.Credentials[0].ID) != "cred-id" {
+		t.Fatalf("GetUser credentials = %+v, want one credential with ID %q", got.Credentials, "cred-id")
+	}
+}
+
+func TestBoltStore_SaveUser_Overwrites(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "webauthn.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore returned an error: %s", err)
+	}
+
+	sub := "user-sub"
+	if err := store.SaveUser(&User{Sub: sub, Username: "alice"}); err != nil {
+		t.Fatalf("SaveUser returned an error: %s", err)
+	}
+	if err := store.SaveUser(&User{Sub: sub, Username: "alice-renamed"}); err != nil {
+		t.Fatalf("SaveUser returned an error: %s", err)
+	}
+
+	got, err := store.GetUser(sub)
+	if err != nil {
+		t.Fatalf("GetUser returned an error: %s", err)
+	}
+	if got.Username != "alice-renamed" {
+		t.Fatalf("GetUser.Username = %q, want %q", got.Username, "alice-renamed")
+	}
+}
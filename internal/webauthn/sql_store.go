@@ -0,0 +1,67 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// SQLStore is an optional Store for deployments that already run a
+// shared SQL database for gangway and would rather not manage a local
+// bbolt file per replica.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore wraps db, creating the backing table if it does not exist.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS webauthn_users (
+		sub  TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize webauthn_users table: %s", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) GetUser(sub string) (*User, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT data FROM webauthn_users WHERE sub = ?`, sub).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{}
+	if err := json.Unmarshal([]byte(raw), u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *SQLStore) SaveUser(u *User) error {
+	raw, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO webauthn_users (sub, data) VALUES (?, ?)
+		ON CONFLICT(sub) DO UPDATE SET data = excluded.data`, u.Sub, string(raw))
+	return err
+}
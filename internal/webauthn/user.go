@@ -0,0 +1,38 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	gowebauthn "github.com/go-webauthn/webauthn/webauthn"
+)
+
+// User adapts an OIDC-authenticated subject to the go-webauthn/webauthn
+// User interface. Credentials are keyed by the OIDC `sub` claim, not a
+// local username, so a registered authenticator follows the user across
+// IdP sessions.
+type User struct {
+	Sub         string                  `json:"sub"`
+	Username    string                  `json:"username"`
+	Credentials []gowebauthn.Credential `json:"credentials"`
+}
+
+func (u *User) WebAuthnID() []byte          { return []byte(u.Sub) }
+func (u *User) WebAuthnName() string        { return u.Username }
+func (u *User) WebAuthnDisplayName() string { return u.Username }
+func (u *User) WebAuthnIcon() string        { return "" }
+
+func (u *User) WebAuthnCredentials() []gowebauthn.Credential {
+	return u.Credentials
+}
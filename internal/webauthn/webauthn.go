@@ -0,0 +1,163 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webauthn gates kubeconfig issuance behind a WebAuthn
+// second-factor assertion, in addition to OIDC SSO, by wrapping
+// go-webauthn/webauthn. Ceremony state and encoded options are handled
+// as opaque JSON so that callers (gangway's HTTP handlers) never need to
+// import go-webauthn themselves.
+package webauthn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	gowebauthn "github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Config configures the relying party parameters handed to go-webauthn.
+type Config struct {
+	RPDisplayName string
+	RPID          string
+	RPOrigin      string
+}
+
+// Manager registers and verifies WebAuthn credentials for OIDC subjects.
+type Manager struct {
+	webAuthn *gowebauthn.WebAuthn
+	store    Store
+}
+
+// NewManager constructs a Manager backed by store.
+func NewManager(cfg Config, store Store) (*Manager, error) {
+	w, err := gowebauthn.New(&gowebauthn.Config{
+		RPDisplayName: cfg.RPDisplayName,
+		RPID:          cfg.RPID,
+		RPOrigins:     []string{cfg.RPOrigin},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize webauthn: %s", err)
+	}
+	return &Manager{webAuthn: w, store: store}, nil
+}
+
+func (m *Manager) userForSub(sub, username string) (*User, error) {
+	u, err := m.store.GetUser(sub)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		u = &User{Sub: sub, Username: username}
+	}
+	return u, nil
+}
+
+// BeginRegistration starts a credential-creation ceremony for sub. It
+// returns the CredentialCreation options to send to the browser as JSON,
+// and the ceremony's session data, which the caller must stash (e.g. in
+// the gangway session cookie) and hand back to FinishRegistration.
+func (m *Manager) BeginRegistration(sub, username string) (optionsJSON, sessionDataJSON []byte, err error) {
+	u, err := m.userForSub(sub, username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options, sessionData, err := m.webAuthn.BeginRegistration(u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin webauthn registration: %s", err)
+	}
+
+	optionsJSON, err = json.Marshal(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionDataJSON, err = json.Marshal(sessionData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return optionsJSON, sessionDataJSON, nil
+}
+
+// FinishRegistration validates the browser's attestation response in r
+// against sessionDataJSON (as returned by BeginRegistration), then
+// stores the new credential for sub.
+func (m *Manager) FinishRegistration(sub, username string, sessionDataJSON []byte, r *http.Request) error {
+	u, err := m.userForSub(sub, username)
+	if err != nil {
+		return err
+	}
+
+	var sessionData gowebauthn.SessionData
+	if err := json.Unmarshal(sessionDataJSON, &sessionData); err != nil {
+		return fmt.Errorf("invalid webauthn ceremony state: %s", err)
+	}
+
+	cred, err := m.webAuthn.FinishRegistration(u, sessionData, r)
+	if err != nil {
+		return fmt.Errorf("failed to finish webauthn registration: %s", err)
+	}
+
+	u.Credentials = append(u.Credentials, *cred)
+	return m.store.SaveUser(u)
+}
+
+// BeginLogin starts an assertion ceremony for a subject that has already
+// registered at least one credential.
+func (m *Manager) BeginLogin(sub string) (optionsJSON, sessionDataJSON []byte, err error) {
+	u, err := m.store.GetUser(sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil || len(u.Credentials) == 0 {
+		return nil, nil, fmt.Errorf("no registered webauthn credentials for subject %q", sub)
+	}
+
+	options, sessionData, err := m.webAuthn.BeginLogin(u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin webauthn login: %s", err)
+	}
+
+	optionsJSON, err = json.Marshal(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionDataJSON, err = json.Marshal(sessionData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return optionsJSON, sessionDataJSON, nil
+}
+
+// FinishLogin validates the browser's assertion response in r against
+// sessionDataJSON (as returned by BeginLogin).
+func (m *Manager) FinishLogin(sub string, sessionDataJSON []byte, r *http.Request) error {
+	u, err := m.store.GetUser(sub)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("no registered webauthn credentials for subject %q", sub)
+	}
+
+	var sessionData gowebauthn.SessionData
+	if err := json.Unmarshal(sessionDataJSON, &sessionData); err != nil {
+		return fmt.Errorf("invalid webauthn ceremony state: %s", err)
+	}
+
+	if _, err := m.webAuthn.FinishLogin(u, sessionData, r); err != nil {
+		return fmt.Errorf("failed to finish webauthn login: %s", err)
+	}
+	return nil
+}